@@ -18,8 +18,13 @@ package internal
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
+	"sort"
+	"sync"
 
 	kcpcache "github.com/kcp-dev/apimachinery/pkg/cache"
 	"github.com/kcp-dev/logicalcluster"
@@ -41,11 +46,28 @@ import (
 // CacheReader is a client.Reader.
 var _ client.Reader = &CacheReader{}
 
+// ErrCacheNotReady is returned by Get and List instead of blocking when:
+//   - the informer backing the reader was looked up with WithNonBlocking and
+//     has not finished its initial sync yet, or
+//   - the reader has been evicted via Informers.Remove, e.g. because the
+//     controller no longer references that GVK.
+var ErrCacheNotReady = errors.New("cache not ready")
+
 // CacheReader wraps a cache.Index to implement the client.CacheReader interface for a single type.
 type CacheReader struct {
-	// indexer is the underlying indexer wrapped by this cache.
+	// mu guards indexer and stopped. Get and List take it for reading, so
+	// that Remove can stop the informer and release the indexer without
+	// racing a Get or List already in flight.
+	mu sync.RWMutex
+
+	// indexer is the underlying indexer wrapped by this cache. It is cleared
+	// once the reader is evicted.
 	indexer cache.Indexer
 
+	// stopped is set once this reader has been evicted by Informers.Remove.
+	// Get and List return ErrCacheNotReady rather than touch a freed indexer.
+	stopped bool
+
 	// groupVersionKind is the group-version-kind of the resource.
 	groupVersionKind schema.GroupVersionKind
 
@@ -56,10 +78,41 @@ type CacheReader struct {
 	// Be very careful with this, when enabled you must DeepCopy any object before mutating it,
 	// otherwise you will mutate the object in the cache.
 	disableDeepCopy bool
+
+	// getResourceVersion, if set, returns the resource version the indexer
+	// is currently synced to. List records it in the Continue tokens it
+	// mints; a token's resource version is not compared against it when the
+	// token comes back. Left nil, tokens carry an empty resource version.
+	getResourceVersion func() string
+
+	// transformedType is the type a registered TransformFunc produces for
+	// objects entering this reader's indexer, validated and set once at
+	// construction time (see Informers.SetTransform), so Get can give a
+	// precise error if a caller's out doesn't match, instead of the
+	// generic "cache had type X" message. Nil if no transform is registered.
+	transformedType reflect.Type
+}
+
+// evict stops serving Get and List, releasing the indexer. It is called
+// exactly once, by the Informers map that owns this reader, after the
+// informer's reflector has been stopped. Any Get or List already holding a
+// read lock finishes against the live indexer; every call afterwards gets
+// ErrCacheNotReady.
+func (c *CacheReader) evict() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopped = true
+	c.indexer = nil
 }
 
 // Get checks the indexer for the object and writes a copy of it if found.
 func (c *CacheReader) Get(ctx context.Context, key client.ObjectKey, out client.Object) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.stopped {
+		return ErrCacheNotReady
+	}
+
 	if c.scopeName == apimeta.RESTScopeNameRoot {
 		key.Namespace = ""
 	}
@@ -99,6 +152,10 @@ func (c *CacheReader) Get(ctx context.Context, key client.ObjectKey, out client.
 	outVal := reflect.ValueOf(out)
 	objVal := reflect.ValueOf(obj)
 	if !objVal.Type().AssignableTo(outVal.Type()) {
+		if c.transformedType != nil && c.transformedType == objVal.Type() {
+			return fmt.Errorf("cache transform for %s produces %s, but %s was asked for; "+
+				"the transform's output type must match what callers pass to Get", c.groupVersionKind, c.transformedType, outVal.Type())
+		}
 		return fmt.Errorf("cache had type %s, but %s was asked for", objVal.Type(), outVal.Type())
 	}
 	reflect.Indirect(outVal).Set(reflect.Indirect(objVal))
@@ -111,6 +168,12 @@ func (c *CacheReader) Get(ctx context.Context, key client.ObjectKey, out client.
 
 // List lists items out of the indexer and writes them to out.
 func (c *CacheReader) List(ctx context.Context, out client.ObjectList, opts ...client.ListOption) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.stopped {
+		return ErrCacheNotReady
+	}
+
 	var objs []interface{}
 	var err error
 
@@ -126,31 +189,11 @@ func (c *CacheReader) List(ctx context.Context, out client.ObjectList, opts ...c
 		}
 	}
 
-	switch {
-	// TODO(kcp) add cluster to this case
-	case listOpts.FieldSelector != nil:
-		// TODO(directxman12): support more complicated field selectors by
-		// combining multiple indices, GetIndexers, etc
-		field, val, requiresExact := requiresExactMatch(listOpts.FieldSelector)
-		if !requiresExact {
-			return fmt.Errorf("non-exact field matches are not supported by the cache")
-		}
-		// list all objects by the field selector.  If this is namespaced and we have one, ask for the
-		// namespaced index key.  Otherwise, ask for the non-namespaced variant by using the fake "all namespaces"
-		// namespace.
-		objs, err = c.indexer.ByIndex(FieldIndexName(field), KeyToNamespacedKey(listOpts.Namespace, val))
-	case listOpts.Namespace != "":
-		if listOpts.Cluster.Empty() {
-			objs, err = c.indexer.ByIndex(cache.NamespaceIndex, listOpts.Namespace)
-		} else {
-			objs, err = c.indexer.ByIndex(kcpcache.ClusterAndNamespaceIndexName, kcpcache.ToClusterAwareKey(listOpts.Cluster.String(), listOpts.Namespace, ""))
-		}
-	default:
-		if listOpts.Cluster.Empty() {
-			objs = c.indexer.List()
-		} else {
-			objs, err = c.indexer.ByIndex(kcpcache.ClusterIndexName, kcpcache.ToClusterAwareKey(listOpts.Cluster.String(), "", ""))
-		}
+	// TODO(kcp) add cluster to the field-selector case
+	if listOpts.FieldSelector != nil {
+		objs, err = c.listByFieldSelector(listOpts)
+	} else {
+		objs, err = c.listNamespaceScoped(listOpts)
 	}
 	if err != nil {
 		return err
@@ -159,16 +202,57 @@ func (c *CacheReader) List(ctx context.Context, out client.ObjectList, opts ...c
 	if listOpts.LabelSelector != nil {
 		labelSel = listOpts.LabelSelector
 	}
+	objs, err = c.narrowByLabelIndex(objs, labelSel)
+	if err != nil {
+		return err
+	}
+
+	// Sort by store key so that a Continue token ("resume after this key")
+	// has a stable, deterministic meaning across calls, the same way the
+	// API server pages by an opaque but consistent ordering.
+	storeKeys := make([]string, len(objs))
+	for i, obj := range objs {
+		key, err := objectToStoreKey(obj)
+		if err != nil {
+			return err
+		}
+		storeKeys[i] = key
+	}
+	sort.Sort(&objsByStoreKey{objs: objs, keys: storeKeys})
+
+	startIdx := 0
+	currentRV := c.currentResourceVersion()
+	if listOpts.Continue != "" {
+		tok, err := decodeContinueToken(listOpts.Continue)
+		if err != nil {
+			return err
+		}
+		startIdx = sort.SearchStrings(storeKeys, tok.LastKey)
+		if startIdx < len(storeKeys) && storeKeys[startIdx] == tok.LastKey {
+			startIdx++
+		} else if tok.LastKey != "" {
+			// The object the token resumed after is no longer in the cache.
+			// Resuming at the insertion point would still be correct - every
+			// key from here on sorts after LastKey regardless of what else
+			// changed - but we can't distinguish "deleted" from "replaced by
+			// something resumption would miss", so conservatively ask the
+			// caller to restart rather than risk silently skipping objects.
+			return ErrResourceVersionTooOld
+		}
+	}
 
 	limitSet := listOpts.Limit > 0
 
-	runtimeObjs := make([]runtime.Object, 0, len(objs))
-	for _, item := range objs {
+	runtimeObjs := make([]runtime.Object, 0, len(objs)-startIdx)
+	continueToken := ""
+	for i := startIdx; i < len(objs); i++ {
 		// if the Limit option is set and the number of items
 		// listed exceeds this limit, then stop reading.
 		if limitSet && int64(len(runtimeObjs)) >= listOpts.Limit {
+			continueToken = encodeContinueToken(currentRV, storeKeys[i-1])
 			break
 		}
+		item := objs[i]
 		obj, isObj := item.(runtime.Object)
 		if !isObj {
 			return fmt.Errorf("cache contained %T, which is not an Object", obj)
@@ -195,7 +279,29 @@ func (c *CacheReader) List(ctx context.Context, out client.ObjectList, opts ...c
 		}
 		runtimeObjs = append(runtimeObjs, outObj)
 	}
-	return apimeta.SetList(out, runtimeObjs)
+
+	if err := apimeta.SetList(out, runtimeObjs); err != nil {
+		return err
+	}
+	if continueToken != "" {
+		listAccessor, err := apimeta.ListAccessor(out)
+		if err != nil {
+			return err
+		}
+		listAccessor.SetContinue(continueToken)
+	}
+	return nil
+}
+
+// currentResourceVersion returns the resource version the indexer is
+// currently synced to, or "" if this reader has no way to determine one.
+// It's a hook rather than a field so readers that aren't wired up to a
+// reflector (e.g. in tests) can simply leave it unset.
+func (c *CacheReader) currentResourceVersion() string {
+	if c.getResourceVersion == nil {
+		return ""
+	}
+	return c.getResourceVersion()
 }
 
 // objectKeyToStorageKey converts an object key to store key.
@@ -214,17 +320,247 @@ func objectKeyToStoreKey(ctx context.Context, k client.ObjectKey) string {
 	return k.Namespace + "/" + k.Name
 }
 
-// requiresExactMatch checks if the given field selector is of the form `k=v` or `k==v`.
-func requiresExactMatch(sel fields.Selector) (field, val string, required bool) {
-	reqs := sel.Requirements()
-	if len(reqs) != 1 {
-		return "", "", false
+// listNamespaceScoped lists the indexer honoring only namespace/cluster
+// scoping, with no field or label filtering. It backs both the no-selector
+// path in List and the base set listByFieldSelector narrows when a
+// selector has no Equals/DoubleEquals requirement to intersect, so that a
+// NotEquals-only (or otherwise all-indexed-but-no-positive) field selector
+// on a namespaced List can't pull in objects from other namespaces or
+// clusters.
+func (c *CacheReader) listNamespaceScoped(listOpts client.ListOptions) ([]interface{}, error) {
+	if listOpts.Namespace != "" {
+		if listOpts.Cluster.Empty() {
+			return c.indexer.ByIndex(cache.NamespaceIndex, listOpts.Namespace)
+		}
+		return c.indexer.ByIndex(kcpcache.ClusterAndNamespaceIndexName, kcpcache.ToClusterAwareKey(listOpts.Cluster.String(), listOpts.Namespace, ""))
+	}
+	if listOpts.Cluster.Empty() {
+		return c.indexer.List(), nil
+	}
+	return c.indexer.ByIndex(kcpcache.ClusterIndexName, kcpcache.ToClusterAwareKey(listOpts.Cluster.String(), "", ""))
+}
+
+// objectToStoreKey derives an object's indexer store key from its own
+// metadata, mirroring objectKeyToStoreKey's convention of a cluster-aware
+// key when the object carries a logical cluster, and a plain
+// namespace/name key otherwise. List uses it (instead of a plain
+// cache.MetaNamespaceKeyFunc) to sort and diff objects for pagination and
+// index intersection, so that two clusters' same-namespace/name objects
+// don't collide into a single key.
+func objectToStoreKey(obj interface{}) (string, error) {
+	accessor, err := apimeta.Accessor(obj)
+	if err != nil {
+		return "", err
+	}
+	cluster := logicalcluster.From(accessor)
+	if cluster.Empty() {
+		return cache.MetaNamespaceKeyFunc(obj)
+	}
+	return kcpcache.ToClusterAwareKey(cluster.String(), accessor.GetNamespace(), accessor.GetName()), nil
+}
+
+// listByFieldSelector resolves listOpts.FieldSelector against registered
+// field indices, combining multiple requirements by intersecting the
+// per-requirement index results. Equals/DoubleEquals requirements narrow
+// the result down; NotEquals requirements filter it. A requirement whose
+// field has no registered index falls back to the prior behavior of
+// refusing the list outright, so callers get a clear signal to register an
+// index via FieldIndexer rather than a silently-wrong result.
+func (c *CacheReader) listByFieldSelector(listOpts client.ListOptions) ([]interface{}, error) {
+	reqs := listOpts.FieldSelector.Requirements()
+	indexers := c.indexer.GetIndexers()
+
+	var positive, negative []fields.Requirement
+	for _, req := range reqs {
+		if _, ok := indexers[FieldIndexName(req.Field)]; !ok {
+			return nil, fmt.Errorf("non-exact field matches are not supported by the cache")
+		}
+		switch req.Operator {
+		case selection.Equals, selection.DoubleEquals:
+			positive = append(positive, req)
+		case selection.NotEquals:
+			negative = append(negative, req)
+		default:
+			return nil, fmt.Errorf("non-exact field matches are not supported by the cache")
+		}
+	}
+
+	base, err := c.listNamespaceScoped(listOpts)
+	if err != nil {
+		return nil, err
+	}
+	if len(positive) > 0 {
+		sets := make([][]interface{}, 0, len(positive))
+		for _, req := range positive {
+			matches, err := c.indexer.ByIndex(FieldIndexName(req.Field), KeyToNamespacedKey(listOpts.Namespace, req.Value))
+			if err != nil {
+				return nil, err
+			}
+			sets = append(sets, matches)
+		}
+		base = intersectByStoreKey(sets)
+	}
+	if len(negative) == 0 {
+		return base, nil
+	}
+
+	exclude := make(map[string]struct{})
+	for _, req := range negative {
+		matches, err := c.indexer.ByIndex(FieldIndexName(req.Field), KeyToNamespacedKey(listOpts.Namespace, req.Value))
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range matches {
+			if key, err := objectToStoreKey(obj); err == nil {
+				exclude[key] = struct{}{}
+			}
+		}
+	}
+
+	result := make([]interface{}, 0, len(base))
+	for _, obj := range base {
+		key, err := objectToStoreKey(obj)
+		if err != nil {
+			return nil, err
+		}
+		if _, excluded := exclude[key]; excluded {
+			continue
+		}
+		result = append(result, obj)
+	}
+	return result, nil
+}
+
+// narrowByLabelIndex shortlists objs using the first Equals/DoubleEquals
+// label requirement in labelSel whose key has a registered LabelIndexName
+// index, intersecting the index lookup with objs so namespace/cluster/field
+// scoping from earlier in List is preserved. The full labelSel.Matches
+// check still runs over the result afterwards, so this is purely a
+// performance shortcut: unregistered keys and non-equality requirements are
+// left for that full scan, same as before.
+func (c *CacheReader) narrowByLabelIndex(objs []interface{}, labelSel labels.Selector) ([]interface{}, error) {
+	if labelSel == nil {
+		return objs, nil
+	}
+	reqs, ok := labelSel.Requirements()
+	if !ok {
+		return objs, nil
+	}
+
+	indexers := c.indexer.GetIndexers()
+	for _, req := range reqs {
+		if req.Operator() != selection.Equals && req.Operator() != selection.DoubleEquals {
+			continue
+		}
+		indexName := LabelIndexName(req.Key())
+		if _, ok := indexers[indexName]; !ok {
+			continue
+		}
+		vals := req.Values().List()
+		if len(vals) != 1 {
+			continue
+		}
+		matches, err := c.indexer.ByIndex(indexName, vals[0])
+		if err != nil {
+			return nil, err
+		}
+		return intersectByStoreKey([][]interface{}{objs, matches}), nil
+	}
+	return objs, nil
+}
+
+// intersectByStoreKey intersects several sets of cached objects, keyed by
+// their indexer store key. It hashes the smallest set into a map and probes
+// the rest against it, so the cost is proportional to the smallest set
+// rather than the product of all of them.
+func intersectByStoreKey(sets [][]interface{}) []interface{} {
+	if len(sets) == 0 {
+		return nil
+	}
+
+	smallest := 0
+	for i, s := range sets {
+		if len(s) < len(sets[smallest]) {
+			smallest = i
+		}
+	}
+
+	present := make(map[string]interface{}, len(sets[smallest]))
+	for _, obj := range sets[smallest] {
+		if key, err := objectToStoreKey(obj); err == nil {
+			present[key] = obj
+		}
+	}
+
+	for i, s := range sets {
+		if i == smallest {
+			continue
+		}
+		inSet := make(map[string]struct{}, len(s))
+		for _, obj := range s {
+			if key, err := objectToStoreKey(obj); err == nil {
+				inSet[key] = struct{}{}
+			}
+		}
+		for key := range present {
+			if _, ok := inSet[key]; !ok {
+				delete(present, key)
+			}
+		}
+	}
+
+	result := make([]interface{}, 0, len(present))
+	for _, obj := range present {
+		result = append(result, obj)
+	}
+	return result
+}
+
+// ErrResourceVersionTooOld is returned when a List call's Continue token
+// resumes after a key that's no longer in the cache. Whatever was at that key
+// is gone, and List can't tell "plain deletion" (safe to resume at the same
+// point) apart from changes that could make resuming silently skip objects,
+// so callers are expected to restart paging from the beginning.
+var ErrResourceVersionTooOld = errors.New("continue token resumes after a key that is no longer in the cache")
+
+// objsByStoreKey sorts a slice of cached objects by their parallel slice of
+// indexer store keys, giving List a stable ordering to page over.
+type objsByStoreKey struct {
+	objs []interface{}
+	keys []string
+}
+
+func (s *objsByStoreKey) Len() int      { return len(s.objs) }
+func (s *objsByStoreKey) Swap(i, j int) { s.objs[i], s.objs[j] = s.objs[j], s.objs[i]; s.keys[i], s.keys[j] = s.keys[j], s.keys[i] }
+func (s *objsByStoreKey) Less(i, j int) bool { return s.keys[i] < s.keys[j] }
+
+// continueToken is the decoded form of a List Continue token: resume just
+// after LastKey. ResourceVersion records the resourceVersion the cache was
+// synced to when the token was minted; it's carried along for diagnostics
+// but, unlike the API server's continue tokens, isn't used to reject the
+// token, since an in-memory indexer has no compaction for it to detect -
+// see ErrResourceVersionTooOld.
+type continueToken struct {
+	ResourceVersion string `json:"resourceVersion"`
+	LastKey         string `json:"lastKey"`
+}
+
+func encodeContinueToken(resourceVersion, lastKey string) string {
+	// Marshaling a fixed, simple struct cannot fail.
+	b, _ := json.Marshal(continueToken{ResourceVersion: resourceVersion, LastKey: lastKey})
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func decodeContinueToken(tok string) (continueToken, error) {
+	var ct continueToken
+	b, err := base64.StdEncoding.DecodeString(tok)
+	if err != nil {
+		return ct, fmt.Errorf("invalid continue token: %w", err)
 	}
-	req := reqs[0]
-	if req.Operator != selection.Equals && req.Operator != selection.DoubleEquals {
-		return "", "", false
+	if err := json.Unmarshal(b, &ct); err != nil {
+		return ct, fmt.Errorf("invalid continue token: %w", err)
 	}
-	return req.Field, req.Value, true
+	return ct, nil
 }
 
 // FieldIndexName constructs the name of the index over the given field,
@@ -0,0 +1,277 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func newTestObj(ns, name string, fieldVals map[string]string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	u.SetNamespace(ns)
+	u.SetName(name)
+	for field, val := range fieldVals {
+		_ = unstructured.SetNestedField(u.Object, val, strings.Split(field, ".")...)
+	}
+	return u
+}
+
+func fieldIndexFunc(field string) cache.IndexFunc {
+	path := strings.Split(field, ".")
+	return func(obj interface{}) ([]string, error) {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return nil, nil
+		}
+		val, _, err := unstructured.NestedString(u.Object, path...)
+		if err != nil {
+			return nil, err
+		}
+		return []string{KeyToNamespacedKey(u.GetNamespace(), val)}, nil
+	}
+}
+
+func newTestIndexer(indexedFields ...string) cache.Indexer {
+	indexers := cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}
+	for _, field := range indexedFields {
+		indexers[FieldIndexName(field)] = fieldIndexFunc(field)
+	}
+	return cache.NewIndexer(cache.MetaNamespaceKeyFunc, indexers)
+}
+
+func TestListByFieldSelectorScopesNotEqualsFallbackToNamespace(t *testing.T) {
+	indexer := newTestIndexer("f")
+	add := func(ns, name, f string) {
+		if err := indexer.Add(newTestObj(ns, name, map[string]string{"f": f})); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	add("ns1", "a", "x")
+	add("ns1", "b", "y")
+	add("ns2", "c", "y") // same field value as ns1/b, different namespace
+
+	r := &CacheReader{indexer: indexer}
+	sel, err := fields.ParseSelector("f!=x")
+	if err != nil {
+		t.Fatalf("ParseSelector: %v", err)
+	}
+
+	objs, err := r.listByFieldSelector(client.ListOptions{Namespace: "ns1", FieldSelector: sel})
+	if err != nil {
+		t.Fatalf("listByFieldSelector: %v", err)
+	}
+	if len(objs) != 1 {
+		t.Fatalf("expected exactly 1 object scoped to ns1, got %d: %v", len(objs), objs)
+	}
+	got := objs[0].(*unstructured.Unstructured)
+	if got.GetNamespace() != "ns1" || got.GetName() != "b" {
+		t.Fatalf("expected ns1/b, got %s/%s (a NotEquals selector must not leak objects from other namespaces)", got.GetNamespace(), got.GetName())
+	}
+}
+
+func TestListByFieldSelectorIntersectsMultipleRequirements(t *testing.T) {
+	indexer := newTestIndexer("f1", "f2")
+	add := func(name, f1, f2 string) {
+		if err := indexer.Add(newTestObj("ns", name, map[string]string{"f1": f1, "f2": f2})); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	add("a", "x", "y")
+	add("b", "x", "z")
+	add("c", "q", "y")
+
+	r := &CacheReader{indexer: indexer}
+	sel, err := fields.ParseSelector("f1=x,f2=y")
+	if err != nil {
+		t.Fatalf("ParseSelector: %v", err)
+	}
+
+	objs, err := r.listByFieldSelector(client.ListOptions{Namespace: "ns", FieldSelector: sel})
+	if err != nil {
+		t.Fatalf("listByFieldSelector: %v", err)
+	}
+	if len(objs) != 1 || objs[0].(*unstructured.Unstructured).GetName() != "a" {
+		t.Fatalf("expected only object a to match both requirements, got %v", objs)
+	}
+}
+
+func TestListByFieldSelectorUnindexedFieldFallsBack(t *testing.T) {
+	indexer := newTestIndexer("f1")
+	r := &CacheReader{indexer: indexer}
+	sel, err := fields.ParseSelector("f2=x")
+	if err != nil {
+		t.Fatalf("ParseSelector: %v", err)
+	}
+	if _, err := r.listByFieldSelector(client.ListOptions{FieldSelector: sel}); err == nil {
+		t.Fatal("expected an error for a field with no registered index")
+	}
+}
+
+func TestListPaginatesWithContinueToken(t *testing.T) {
+	indexer := newTestIndexer()
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		if err := indexer.Add(newTestObj("ns", name, nil)); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	// A live informer's LastSyncResourceVersion advances on every watch event,
+	// so it will have moved on between page1 and page2 for any real caller.
+	// Pagination must not treat that as staleness on its own.
+	rv := 100
+	r := &CacheReader{indexer: indexer, disableDeepCopy: true, getResourceVersion: func() string {
+		rv++
+		return strconv.Itoa(rv)
+	}}
+
+	var page1 unstructured.UnstructuredList
+	if err := r.List(context.Background(), &page1, client.InNamespace("ns"), client.Limit(2)); err != nil {
+		t.Fatalf("List page1: %v", err)
+	}
+	if len(page1.Items) != 2 {
+		t.Fatalf("expected 2 items in page1, got %d", len(page1.Items))
+	}
+	cont := page1.GetContinue()
+	if cont == "" {
+		t.Fatal("expected a Continue token when Limit truncates the list")
+	}
+
+	var page2 unstructured.UnstructuredList
+	if err := r.List(context.Background(), &page2, client.InNamespace("ns"), client.Limit(2), client.Continue(cont)); err != nil {
+		t.Fatalf("List page2: %v", err)
+	}
+	if len(page2.Items) != 2 {
+		t.Fatalf("expected 2 items in page2, got %d", len(page2.Items))
+	}
+
+	seen := map[string]bool{}
+	for _, it := range page1.Items {
+		seen[it.GetName()] = true
+	}
+	for _, it := range page2.Items {
+		if seen[it.GetName()] {
+			t.Fatalf("object %s appeared in both pages", it.GetName())
+		}
+		seen[it.GetName()] = true
+	}
+	if len(seen) != 4 {
+		t.Fatalf("expected 4 distinct objects across two pages of 2, got %d: %v", len(seen), seen)
+	}
+}
+
+func TestListRejectsContinueTokenWhoseLastKeyIsGone(t *testing.T) {
+	indexer := newTestIndexer()
+	if err := indexer.Add(newTestObj("ns", "a", nil)); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	r := &CacheReader{indexer: indexer, disableDeepCopy: true, getResourceVersion: func() string { return "100" }}
+
+	// "ns/zzz" was never added, simulating a token whose resume point has
+	// since been deleted from the cache.
+	tok := encodeContinueToken("100", "ns/zzz")
+	var out unstructured.UnstructuredList
+	err := r.List(context.Background(), &out, client.Continue(tok))
+	if !errors.Is(err, ErrResourceVersionTooOld) {
+		t.Fatalf("expected ErrResourceVersionTooOld for a token whose LastKey is no longer present, got %v", err)
+	}
+}
+
+// labelIndexFunc mirrors the IndexFunc Informers.IndexLabel installs, for
+// tests that need a label index without going through a full Informers.
+func labelIndexFunc(key string) cache.IndexFunc {
+	return func(obj interface{}) ([]string, error) {
+		accessor, err := apimeta.Accessor(obj)
+		if err != nil {
+			return nil, err
+		}
+		val, ok := accessor.GetLabels()[key]
+		if !ok {
+			return nil, nil
+		}
+		return []string{val}, nil
+	}
+}
+
+func TestNarrowByLabelIndexUsesRegisteredIndex(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+		cache.NamespaceIndex:   cache.MetaNamespaceIndexFunc,
+		LabelIndexName("team"): labelIndexFunc("team"),
+	})
+	add := func(name, team string) {
+		u := newTestObj("ns", name, nil)
+		u.SetLabels(map[string]string{"team": team})
+		if err := indexer.Add(u); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	add("a", "x")
+	add("b", "y")
+	add("c", "x")
+
+	r := &CacheReader{indexer: indexer}
+	sel, err := labels.Parse("team=x")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	objs, err := r.narrowByLabelIndex(indexer.List(), sel)
+	if err != nil {
+		t.Fatalf("narrowByLabelIndex: %v", err)
+	}
+	names := map[string]bool{}
+	for _, obj := range objs {
+		names[obj.(*unstructured.Unstructured).GetName()] = true
+	}
+	if len(names) != 2 || !names["a"] || !names["c"] {
+		t.Fatalf("expected the registered team index to narrow the result to {a, c}, got %v", names)
+	}
+}
+
+func TestNarrowByLabelIndexFallsBackForUnregisteredKey(t *testing.T) {
+	indexer := newTestIndexer() // no label index registered
+	u := newTestObj("ns", "a", nil)
+	u.SetLabels(map[string]string{"team": "x"})
+	if err := indexer.Add(u); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	r := &CacheReader{indexer: indexer}
+	sel, err := labels.Parse("team=x")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	all := indexer.List()
+	objs, err := r.narrowByLabelIndex(all, sel)
+	if err != nil {
+		t.Fatalf("narrowByLabelIndex: %v", err)
+	}
+	if len(objs) != len(all) {
+		t.Fatalf("expected narrowByLabelIndex to pass objs through unfiltered when no index is registered for the label key, got %d of %d", len(objs), len(all))
+	}
+}
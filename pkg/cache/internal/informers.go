@@ -0,0 +1,330 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// TransformFunc is invoked once for each object as it enters a GVK's
+// informer store, before indexing, mirroring client-go's
+// SharedIndexInformer.SetTransform. It lets callers strip fields they don't
+// need, such as managedFields, large spec blobs, or vendor annotations,
+// cutting the cache's resident memory. It composes with disableDeepCopy:
+// since the stored object is already the transformed one, the zero-copy
+// fast path on CacheReader.Get/List hands it out as-is, same as untransformed
+// objects.
+type TransformFunc func(obj client.Object) (client.Object, error)
+
+// LabelIndexName constructs the name of the index over the given label key,
+// for use with an indexer.
+func LabelIndexName(key string) string {
+	return "label:" + key
+}
+
+// NewInformerFunc builds the informer that will back a CacheReader for gvk,
+// the first time Informers.Get sees a request for it, along with the scope
+// (namespaced or cluster-scoped) used to key objects in that informer's
+// indexer. The returned informer must not have been started yet.
+type NewInformerFunc func(gvk schema.GroupVersionKind) (informer cache.SharedIndexInformer, scope apimeta.RESTScopeName, err error)
+
+// informerEntry pairs a running informer with the CacheReader that fronts
+// it and the stopCh used to tear both down on eviction.
+type informerEntry struct {
+	informer cache.SharedIndexInformer
+	reader   *CacheReader
+	stopCh   chan struct{}
+}
+
+// Informers tracks the set of started per-GVK informers and the
+// CacheReaders backing them. Beyond a plain map, it lets callers probe for
+// an informer without blocking on its initial sync (GetByGVKIfExists) and
+// evict one that is no longer needed (Remove). That pairing is what lets
+// controllers that dynamically watch a user-supplied set of types (for
+// example policy controllers resolving references out of admitted
+// policies) bound their memory use over the life of the process, instead of
+// accumulating one informer per type ever seen.
+type Informers struct {
+	mu sync.RWMutex
+
+	// newInformer constructs the informer for a GVK the first time Get sees it.
+	newInformer NewInformerFunc
+
+	byGVK map[schema.GroupVersionKind]*informerEntry
+
+	// indexers are installed on every informer's indexer as it's started;
+	// see IndexLabel.
+	indexers cache.Indexers
+
+	// transforms are installed on a given GVK's informer as it's started;
+	// see SetTransform.
+	transforms map[schema.GroupVersionKind]registeredTransform
+}
+
+// NewInformers creates an empty Informers map that starts informers on
+// demand using newInformer.
+func NewInformers(newInformer NewInformerFunc) *Informers {
+	return &Informers{
+		newInformer: newInformer,
+		byGVK:       make(map[schema.GroupVersionKind]*informerEntry),
+	}
+}
+
+// GetOptions configures a call to Informers.Get.
+type GetOptions struct {
+	// NonBlocking causes Get to return ErrCacheNotReady immediately if the
+	// informer for the requested GVK has not finished its initial sync,
+	// instead of blocking until it has.
+	NonBlocking bool
+}
+
+// GetOption mutates a GetOptions.
+type GetOption func(*GetOptions)
+
+// WithNonBlocking makes Get fail fast with ErrCacheNotReady rather than
+// wait for the informer to sync.
+func WithNonBlocking() GetOption {
+	return func(o *GetOptions) { o.NonBlocking = true }
+}
+
+// IndexLabel registers an index, keyed LabelIndexName(key), whose index
+// function emits the one value an object has for label key, mirroring a
+// field index but over labels. CacheReader.List then drives an Equals
+// requirement on a registered key through indexer.ByIndex instead of
+// scanning every object in the cache, same as it already does for field
+// selectors, while unregistered keys keep working via the full label match.
+//
+// The index is installed on every informer, since label keys aren't
+// type-specific. Like client-go indexers in general, it can only be added
+// before an informer's store has seen any objects, so IndexLabel only
+// affects informers started after the call and returns an error once any
+// informer has been started.
+func (m *Informers) IndexLabel(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.byGVK) > 0 {
+		return fmt.Errorf("cannot index label %q: informers are already running", key)
+	}
+
+	indexName := LabelIndexName(key)
+	if m.indexers == nil {
+		m.indexers = cache.Indexers{}
+	}
+	if _, ok := m.indexers[indexName]; ok {
+		return nil
+	}
+	m.indexers[indexName] = func(obj interface{}) ([]string, error) {
+		accessor, err := apimeta.Accessor(obj)
+		if err != nil {
+			return nil, err
+		}
+		val, ok := accessor.GetLabels()[key]
+		if !ok {
+			return nil, nil
+		}
+		return []string{val}, nil
+	}
+	return nil
+}
+
+// registeredTransform pairs a TransformFunc with the type it's declared to
+// produce, so that type can be validated up front at SetTransform time and
+// then handed straight to a CacheReader as soon as it's constructed, rather
+// than waiting to learn it from the first object that's actually
+// transformed.
+type registeredTransform struct {
+	fn      TransformFunc
+	outType reflect.Type
+}
+
+// SetTransform registers transform to run on each object entering gvk's
+// informer store, before it's indexed. transformsTo must be an example of
+// the type transform produces (typically a zero-value pointer, e.g.
+// &metav1.PartialObjectMetadata{}), and out an example of the type callers
+// will pass to CacheReader.Get/List for gvk once the transform is in
+// place. SetTransform validates transformsTo is assignable to out right
+// away, so a mismatch is rejected at registration time instead of
+// surfacing later as Get's generic "cache had type X" error.
+//
+// Like indexers, client-go only allows setting a transform before the
+// informer's store has seen any objects, so SetTransform also returns an
+// error if gvk's informer is already running; it only takes effect the
+// next time Get starts one.
+func (m *Informers) SetTransform(gvk schema.GroupVersionKind, transform TransformFunc, transformsTo, out client.Object) error {
+	transformsToType := reflect.TypeOf(transformsTo)
+	outType := reflect.TypeOf(out)
+	if !transformsToType.AssignableTo(outType) {
+		return fmt.Errorf("cannot set transform for %s: it produces %s, but %s will be asked for by Get", gvk, transformsToType, outType)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.byGVK[gvk]; ok {
+		return fmt.Errorf("cannot set transform for %s: informer already started", gvk)
+	}
+	if m.transforms == nil {
+		m.transforms = make(map[schema.GroupVersionKind]registeredTransform)
+	}
+	m.transforms[gvk] = registeredTransform{fn: transform, outType: transformsToType}
+	return nil
+}
+
+// GetByGVKIfExists returns the CacheReader for gvk without starting an
+// informer and without waiting for it to sync. It is meant for callers that
+// only want to know whether gvk is already being watched, such as a
+// reconciler deciding whether Remove needs to be called for a type it no
+// longer references.
+func (m *Informers) GetByGVKIfExists(gvk schema.GroupVersionKind) (*CacheReader, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	e, ok := m.byGVK[gvk]
+	if !ok {
+		return nil, false
+	}
+	return e.reader, true
+}
+
+// Get returns the CacheReader for gvk, starting its informer if this is the
+// first request for that type. By default Get blocks until the informer's
+// initial sync completes; pass WithNonBlocking to get ErrCacheNotReady back
+// immediately instead.
+func (m *Informers) Get(ctx context.Context, gvk schema.GroupVersionKind, opts ...GetOption) (*CacheReader, error) {
+	options := GetOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	e, err := m.getOrStart(gvk)
+	if err != nil {
+		return nil, err
+	}
+
+	if !e.informer.HasSynced() {
+		if options.NonBlocking {
+			return nil, ErrCacheNotReady
+		}
+		// e.stopCh is closed by Remove, so a concurrent eviction of gvk
+		// unblocks WaitForCacheSync the same way ctx cancellation does,
+		// instead of leaving this call parked on an informer that will now
+		// never sync.
+		if !cache.WaitForCacheSync(stopOrDone(ctx, e.stopCh), e.informer.HasSynced) {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("failed waiting for %s informer to sync: %w", gvk, ctx.Err())
+			}
+			return nil, ErrCacheNotReady
+		}
+	}
+	return e.reader, nil
+}
+
+// stopOrDone returns a channel that closes as soon as either ctx is done or
+// stop is closed.
+func stopOrDone(ctx context.Context, stop <-chan struct{}) <-chan struct{} {
+	out := make(chan struct{})
+	go func() {
+		defer close(out)
+		select {
+		case <-ctx.Done():
+		case <-stop:
+		}
+	}()
+	return out
+}
+
+// getOrStart returns the entry for gvk, creating and starting its informer
+// if one hasn't been started yet.
+func (m *Informers) getOrStart(gvk schema.GroupVersionKind) (*informerEntry, error) {
+	m.mu.RLock()
+	e, ok := m.byGVK[gvk]
+	m.mu.RUnlock()
+	if ok {
+		return e, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e, ok := m.byGVK[gvk]; ok {
+		return e, nil
+	}
+
+	informer, scope, err := m.newInformer(gvk)
+	if err != nil {
+		return nil, err
+	}
+	if len(m.indexers) > 0 {
+		if err := informer.AddIndexers(m.indexers); err != nil {
+			return nil, err
+		}
+	}
+
+	stopCh := make(chan struct{})
+	reader := &CacheReader{
+		indexer:            informer.GetIndexer(),
+		groupVersionKind:   gvk,
+		scopeName:          scope,
+		getResourceVersion: informer.LastSyncResourceVersion,
+	}
+	if rt, ok := m.transforms[gvk]; ok {
+		reader.transformedType = rt.outType
+		if err := informer.SetTransform(func(obj interface{}) (interface{}, error) {
+			typed, ok := obj.(client.Object)
+			if !ok {
+				return obj, nil
+			}
+			return rt.fn(typed)
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	e = &informerEntry{
+		informer: informer,
+		stopCh:   stopCh,
+		reader:   reader,
+	}
+	m.byGVK[gvk] = e
+	go informer.Run(stopCh)
+	return e, nil
+}
+
+// Remove stops and evicts the informer for gvk, if one has been started.
+// It stops the underlying reflector by closing its stopCh, and then marks
+// the CacheReader as evicted, waiting for any Get/List already in flight to
+// finish against the live indexer first; every Get/List after that returns
+// ErrCacheNotReady. Remove is a no-op if no informer for gvk has been started.
+func (m *Informers) Remove(gvk schema.GroupVersionKind) {
+	m.mu.Lock()
+	e, ok := m.byGVK[gvk]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+	delete(m.byGVK, gvk)
+	m.mu.Unlock()
+
+	close(e.stopCh)
+	e.reader.evict()
+}
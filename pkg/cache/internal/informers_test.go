@@ -0,0 +1,274 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// newFakeInformerFunc returns a NewInformerFunc backed by an empty ListWatch
+// and a fake watch.Interface, plus a cleanup func that stops that watch.
+func newFakeInformerFunc() (NewInformerFunc, func()) {
+	w := watch.NewFake()
+	newInformer := func(gvk schema.GroupVersionKind) (cache.SharedIndexInformer, apimeta.RESTScopeName, error) {
+		lw := &cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return &unstructured.UnstructuredList{}, nil
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return w, nil
+			},
+		}
+		informer := cache.NewSharedIndexInformer(lw, &unstructured.Unstructured{}, 0, cache.Indexers{})
+		return informer, apimeta.RESTScopeNameNamespace, nil
+	}
+	return newInformer, w.Stop
+}
+
+func TestInformersGetByGVKIfExistsAndRemove(t *testing.T) {
+	newInformer, stopWatch := newFakeInformerFunc()
+	defer stopWatch()
+	m := NewInformers(newInformer)
+	gvk := schema.GroupVersionKind{Group: "group", Version: "v1", Kind: "Thing"}
+
+	if _, ok := m.GetByGVKIfExists(gvk); ok {
+		t.Fatal("expected no reader before the first Get")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	reader, err := m.Get(ctx, gvk)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	if got, ok := m.GetByGVKIfExists(gvk); !ok || got != reader {
+		t.Fatal("expected GetByGVKIfExists to return the reader started by Get")
+	}
+
+	m.Remove(gvk)
+
+	if _, ok := m.GetByGVKIfExists(gvk); ok {
+		t.Fatal("expected the reader to be gone after Remove")
+	}
+
+	var out unstructured.Unstructured
+	if err := reader.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "x"}, &out); err != ErrCacheNotReady {
+		t.Fatalf("expected a Get against an evicted reader to return ErrCacheNotReady, got %v", err)
+	}
+
+	// Remove is a no-op once the entry is already gone.
+	m.Remove(gvk)
+}
+
+// TestInformersGetUnblocksWhenRemovedBeforeSync reproduces a caller blocked in
+// Get, waiting for gvk's informer to complete its initial sync, when Remove
+// evicts that same gvk first. Without Get observing e.stopCh, WaitForCacheSync
+// would poll an informer that can now never sync, and a caller using
+// context.Background() (the common case for a reconciler's first Get) would
+// hang forever instead of getting ErrCacheNotReady back.
+func TestInformersGetUnblocksWhenRemovedBeforeSync(t *testing.T) {
+	blockList := make(chan struct{})
+	defer close(blockList)
+
+	newInformer := func(gvk schema.GroupVersionKind) (cache.SharedIndexInformer, apimeta.RESTScopeName, error) {
+		lw := &cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				<-blockList // never completes during the test, so HasSynced never becomes true
+				return &unstructured.UnstructuredList{}, nil
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return watch.NewFake(), nil
+			},
+		}
+		informer := cache.NewSharedIndexInformer(lw, &unstructured.Unstructured{}, 0, cache.Indexers{})
+		return informer, apimeta.RESTScopeNameNamespace, nil
+	}
+
+	m := NewInformers(newInformer)
+	gvk := schema.GroupVersionKind{Group: "group", Version: "v1", Kind: "Thing"}
+
+	getErr := make(chan error, 1)
+	go func() {
+		_, err := m.Get(context.Background(), gvk)
+		getErr <- err
+	}()
+
+	for {
+		if _, ok := m.GetByGVKIfExists(gvk); ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	m.Remove(gvk)
+
+	select {
+	case err := <-getErr:
+		if err != ErrCacheNotReady {
+			t.Fatalf("expected Get to unblock with ErrCacheNotReady once its gvk was removed mid-sync, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Get did not unblock after Remove evicted its gvk before the informer synced")
+	}
+}
+
+// blockingIndexer wraps a real cache.Indexer but blocks inside List until
+// proceed is closed, signalling entered first so a test can know the call has
+// started (and, via CacheReader.List, is holding CacheReader.mu for reading).
+type blockingIndexer struct {
+	cache.Indexer
+	entered chan struct{}
+	proceed chan struct{}
+}
+
+func (b *blockingIndexer) List() []interface{} {
+	close(b.entered)
+	<-b.proceed
+	return b.Indexer.List()
+}
+
+// TestCacheReaderListCompletesDespiteConcurrentEvict exercises the race Remove
+// is meant to resolve: an in-flight List holding CacheReader.mu for reading
+// must run to completion against the live indexer, and evict (which Remove
+// calls under mu.Lock) must wait for it rather than racing it.
+func TestCacheReaderListCompletesDespiteConcurrentEvict(t *testing.T) {
+	real := newTestIndexer()
+	if err := real.Add(newTestObj("ns", "a", nil)); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	blocked := &blockingIndexer{Indexer: real, entered: make(chan struct{}), proceed: make(chan struct{})}
+	r := &CacheReader{indexer: blocked, disableDeepCopy: true}
+
+	type listResult struct {
+		items int
+		err   error
+	}
+	done := make(chan listResult, 1)
+	go func() {
+		var out unstructured.UnstructuredList
+		err := r.List(context.Background(), &out)
+		done <- listResult{items: len(out.Items), err: err}
+	}()
+
+	<-blocked.entered // the List goroutine now holds mu for reading
+
+	evictDone := make(chan struct{})
+	go func() {
+		r.evict()
+		close(evictDone)
+	}()
+
+	select {
+	case <-evictDone:
+		t.Fatal("evict returned while a List was still holding the read lock")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(blocked.proceed)
+	<-evictDone
+
+	res := <-done
+	if res.err != nil {
+		t.Fatalf("an in-flight List should complete against the live indexer despite a concurrent evict, got: %v", res.err)
+	}
+	if res.items != 1 {
+		t.Fatalf("expected the in-flight List to see the live indexer's 1 item, got %d", res.items)
+	}
+}
+
+func TestSetTransformRejectsTypeMismatch(t *testing.T) {
+	newInformer, stopWatch := newFakeInformerFunc()
+	defer stopWatch()
+	m := NewInformers(newInformer)
+	gvk := schema.GroupVersionKind{Group: "group", Version: "v1", Kind: "Thing"}
+
+	err := m.SetTransform(gvk, func(obj client.Object) (client.Object, error) {
+		return obj, nil
+	}, &metav1.PartialObjectMetadata{}, &unstructured.Unstructured{})
+	if err == nil {
+		t.Fatal("expected SetTransform to reject a transform whose declared output type doesn't match out")
+	}
+}
+
+func TestSetTransformRoundTripsThroughGet(t *testing.T) {
+	w := watch.NewFake()
+	defer w.Stop()
+	newInformer := func(gvk schema.GroupVersionKind) (cache.SharedIndexInformer, apimeta.RESTScopeName, error) {
+		lw := &cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return &unstructured.UnstructuredList{}, nil
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return w, nil
+			},
+		}
+		informer := cache.NewSharedIndexInformer(lw, &unstructured.Unstructured{}, 0, cache.Indexers{})
+		return informer, apimeta.RESTScopeNameNamespace, nil
+	}
+	m := NewInformers(newInformer)
+	gvk := schema.GroupVersionKind{Group: "group", Version: "v1", Kind: "Thing"}
+
+	transform := func(obj client.Object) (client.Object, error) {
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return obj, nil
+		}
+		partial := &metav1.PartialObjectMetadata{}
+		partial.Name = u.GetName()
+		partial.Namespace = u.GetNamespace()
+		return partial, nil
+	}
+	if err := m.SetTransform(gvk, transform, &metav1.PartialObjectMetadata{}, &metav1.PartialObjectMetadata{}); err != nil {
+		t.Fatalf("SetTransform: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	reader, err := m.Get(ctx, gvk)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	w.Add(newTestObj("ns", "a", nil))
+
+	var out metav1.PartialObjectMetadata
+	var getErr error
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if getErr = reader.Get(ctx, client.ObjectKey{Namespace: "ns", Name: "a"}, &out); getErr == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if getErr != nil {
+		t.Fatalf("Get after transform: %v", getErr)
+	}
+	if out.Name != "a" || out.Namespace != "ns" {
+		t.Fatalf("expected the registered transform's output (ns/a) to round-trip through Get, got %s/%s", out.Namespace, out.Name)
+	}
+}